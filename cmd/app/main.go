@@ -1,11 +1,13 @@
 package main
 
 import (
+	"app/codec"
 	handler "app/handler"
 	"flag"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -19,19 +21,74 @@ const (
 	DEBUG
 )
 
-var (
-	infoLogger  *log.Logger
-	debugLogger *log.Logger
-)
+// toHandlerLevel maps the config-facing LogLevel onto handler.Level.
+func (l LogLevel) toHandlerLevel() handler.Level {
+	if l == DEBUG {
+		return handler.LevelDebug
+	}
+	return handler.LevelInfo
+}
+
+// UnmarshalYAML lets LogLevel be set in appConfig as "info" or "debug".
+func (l *LogLevel) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch strings.ToLower(s) {
+	case "debug":
+		*l = DEBUG
+	default:
+		*l = INFO
+	}
+	return nil
+}
+
+// errorStoreConfig selects and tunes the ErrorStore implementation.
+type errorStoreConfig struct {
+	// Type is "memory" (default) or "file".
+	Type string `yaml:"type"`
+	// MaxSize bounds how many records are retained; <= 0 means unbounded.
+	MaxSize int `yaml:"maxSize"`
+	// FilePath is the JSONL file backing a "file" store.
+	FilePath string `yaml:"filePath"`
+}
+
+// routeTimeouts sets a per-route handler deadline; zero means no
+// deadline is enforced beyond the server's coarse Read/Write timeouts.
+type routeTimeouts struct {
+	PostTemp  time.Duration `yaml:"postTemp"`
+	GetErrors time.Duration `yaml:"getErrors"`
+	Readme    time.Duration `yaml:"readme"`
+	Delete    time.Duration `yaml:"delete"`
+}
+
+// docsConfig configures the documentation/asset tree served at
+// ReadmeURL (and ReadmeURL's subtree).
+type docsConfig struct {
+	// Root is the directory `.md` files and other assets are served
+	// from; defaults to "." if unset.
+	Root string `yaml:"root"`
+	// BrowsePaths opts specific directories (relative to Root) in to
+	// directory listing; all other directories return 403.
+	BrowsePaths []string `yaml:"browsePaths"`
+}
 
 // appConfig contains app info
 type appConfig struct {
-	AppName      string `yaml:"appName"`
-	Port         int    `yaml:"port"`
-	PostTempURL  string `yaml:"postTempURL"`
-	GetErrorsURL string `yaml:"getErrorsURL"`
-	ReadmeURL    string `yaml:"readmeURL"`
-	DeleteURL    string `yaml:"deleteURL"`
+	AppName       string           `yaml:"appName"`
+	Port          int              `yaml:"port"`
+	PostTempURL   string           `yaml:"postTempURL"`
+	StreamTempURL string           `yaml:"streamTempURL"`
+	GetErrorsURL  string           `yaml:"getErrorsURL"`
+	ReadmeURL     string           `yaml:"readmeURL"`
+	DeleteURL     string           `yaml:"deleteURL"`
+	MetricsURL    string           `yaml:"metricsURL"`
+	ErrorStore    errorStoreConfig `yaml:"errorStore"`
+	Docs          docsConfig       `yaml:"docs"`
+	Timeouts      routeTimeouts    `yaml:"timeouts"`
+	LogLevel      LogLevel         `yaml:"logLevel"`
+	LogJSON       bool             `yaml:"logJSON"`
 }
 
 // Obfuscate obfuscates the config
@@ -74,6 +131,21 @@ func ParseConfig(config interface{}, args []string) error {
 	return nil
 }
 
+// newErrorStore builds the ErrorStore selected by config.
+func newErrorStore(config errorStoreConfig) (handler.ErrorStore, error) {
+	switch config.Type {
+	case "file":
+		store, err := handler.NewFileErrorStore(config.FilePath, config.MaxSize)
+		if err != nil {
+			return nil, errors.Errorf("failed to open file error store. path: %s, error: %v",
+				config.FilePath, err)
+		}
+		return store, nil
+	default:
+		return handler.NewMemoryErrorStore(config.MaxSize), nil
+	}
+}
+
 // runMain is the main function
 func runMain(args []string) {
 	config := &appConfig{}
@@ -84,20 +156,44 @@ func runMain(args []string) {
 		logger.Fatalf("ParseConfig failed. error: %v", err)
 	}
 
+	errorStore, err := newErrorStore(config.ErrorStore)
+	if err != nil {
+		logger.Fatalf("newErrorStore failed. error: %v", err)
+	}
+
+	structuredLogger := handler.NewStructuredLogger(logger, config.LogLevel.toHandlerLevel(), config.LogJSON)
+	metrics := handler.NewMetrics()
+
+	codec.Register(handler.ContentTypeProtobuf, codec.ProtobufCodec{})
+	codec.Register(handler.ContentTypeMsgpack, codec.MsgpackCodec{})
+
+	docsRoot := config.Docs.Root
+	if docsRoot == "" {
+		docsRoot = "."
+	}
+
 	logger.Printf("Starting %s", config.AppName)
 	router := handler.NewRouter()
-	router.GET(config.ReadmeURL, handler.GetReadmeHandler(logger))
-	router.GET(config.GetErrorsURL, handler.GetErrorsHandler(logger))
-	router.DELETE(config.DeleteURL, handler.DeleteHandler(logger))
-	router.POST(config.PostTempURL, handler.PostTempHandler(logger))
+	docsHandler := handler.InstrumentRoute("readme", metrics,
+		handler.WithDeadline(handler.NewDocsHandler(structuredLogger, docsRoot, config.Docs.BrowsePaths), config.Timeouts.Readme))
+	router.GET(config.ReadmeURL, docsHandler)
+	router.GET(config.ReadmeURL+"/*filepath", docsHandler)
+	router.GET(config.GetErrorsURL, handler.InstrumentRoute("getErrors", metrics,
+		handler.WithDeadline(handler.GetErrorsHandler(structuredLogger, errorStore), config.Timeouts.GetErrors)))
+	router.DELETE(config.DeleteURL, handler.InstrumentRoute("delete", metrics,
+		handler.WithDeadline(handler.DeleteHandler(structuredLogger, errorStore), config.Timeouts.Delete)))
+	router.POST(config.PostTempURL, handler.InstrumentRoute("postTemp", metrics,
+		handler.WithDeadline(handler.PostTempHandler(structuredLogger, errorStore, metrics), config.Timeouts.PostTemp)))
+	router.GET(config.StreamTempURL, handler.StreamTempHandler(structuredLogger, errorStore, metrics))
+	router.GET(config.MetricsURL, handler.MetricsHandler(structuredLogger, metrics, errorStore))
 
 	server := handler.NewServer(config.Port, router)
 
 	logger.Printf(
 		"HTTP server running at Port: %d. GetErrors URL: %s, PostTemp URL: %s, "+
-			"Delete URL: %s",
+			"StreamTemp URL: %s, Delete URL: %s, Metrics URL: %s",
 		config.Port, config.GetErrorsURL, config.PostTempURL,
-		config.DeleteURL)
+		config.StreamTempURL, config.DeleteURL, config.MetricsURL)
 
 	if err := server.ListenAndServe(); err != nil {
 		log.Panicf("Failed to start HTTP server. Reason: %v", err)
@@ -0,0 +1,35 @@
+// Package codec provides content-type-selectable encode/decode for the
+// wire payloads this server exchanges with devices, so PostTempHandler
+// can accept a compact binary body instead of the ASCII colon-delimited
+// string embedded in the legacy JSON request.
+//
+// It is deliberately narrow: the protobuf and MessagePack codecs only
+// understand the two shapes below (TempSamplePayload, TempResponsePayload),
+// not arbitrary values.
+package codec
+
+import "io"
+
+// Codec decodes/encodes TempSamplePayload and TempResponsePayload
+// values. ProtobufCodec and MsgpackCodec return an error for any other
+// type; JSONCodec accepts any value encoding/json does.
+type Codec interface {
+	Decode(r io.Reader, v interface{}) error
+	Encode(w io.Writer, v interface{}) error
+}
+
+// TempSamplePayload is the wire shape of a temperature reading, as an
+// alternative to the legacy colon-delimited string carried in a JSON
+// `data` field. See tempsample.proto for the protobuf schema it mirrors.
+type TempSamplePayload struct {
+	DeviceID    string  `json:"device_id"`
+	EpochMs     int64   `json:"epoch_ms"`
+	Temperature float64 `json:"temperature"`
+}
+
+// TempResponsePayload is the wire shape of a PostTemp response.
+type TempResponsePayload struct {
+	DeviceID      string `json:"device_id"`
+	FormattedTime string `json:"formatted_time"`
+	OverTemp      bool   `json:"overtemp"`
+}
@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	in := TempSamplePayload{DeviceID: "365951380", EpochMs: 1640995229697, Temperature: 58.48256793121914}
+	var buf bytes.Buffer
+	require.NoError(t, JSONCodec{}.Encode(&buf, &in))
+
+	var out TempSamplePayload
+	require.NoError(t, JSONCodec{}.Decode(&buf, &out))
+	require.Equal(t, in, out)
+}
+
+func TestProtobufCodecRoundTrip(t *testing.T) {
+	in := TempSamplePayload{DeviceID: "365951380", EpochMs: 1640995229697, Temperature: 58.48256793121914}
+	var buf bytes.Buffer
+	require.NoError(t, ProtobufCodec{}.Encode(&buf, &in))
+
+	var out TempSamplePayload
+	require.NoError(t, ProtobufCodec{}.Decode(&buf, &out))
+	require.Equal(t, in, out)
+
+	respIn := TempResponsePayload{DeviceID: "365951380", FormattedTime: "2022/01/01 00:00:00", OverTemp: true}
+	buf.Reset()
+	require.NoError(t, ProtobufCodec{}.Encode(&buf, &respIn))
+
+	var respOut TempResponsePayload
+	require.NoError(t, ProtobufCodec{}.Decode(&buf, &respOut))
+	require.Equal(t, respIn, respOut)
+}
+
+func TestMsgpackCodecRoundTrip(t *testing.T) {
+	in := TempSamplePayload{DeviceID: "365951380", EpochMs: 1640995229697, Temperature: 58.48256793121914}
+	var buf bytes.Buffer
+	require.NoError(t, MsgpackCodec{}.Encode(&buf, &in))
+
+	var out TempSamplePayload
+	require.NoError(t, MsgpackCodec{}.Decode(&buf, &out))
+	require.Equal(t, in, out)
+
+	respIn := TempResponsePayload{DeviceID: "365951380", FormattedTime: "2022/01/01 00:00:00", OverTemp: false}
+	buf.Reset()
+	require.NoError(t, MsgpackCodec{}.Encode(&buf, &respIn))
+
+	var respOut TempResponsePayload
+	require.NoError(t, MsgpackCodec{}.Decode(&buf, &respOut))
+	require.Equal(t, respIn, respOut)
+}
+
+func TestRegistryLookup(t *testing.T) {
+	_, ok := Lookup("application/json")
+	require.True(t, ok, "application/json should be registered by default")
+
+	_, ok = Lookup("application/does-not-exist")
+	require.False(t, ok)
+
+	Register("application/x-protobuf", ProtobufCodec{})
+	c, ok := Lookup("application/x-protobuf")
+	require.True(t, ok)
+	require.IsType(t, ProtobufCodec{}, c)
+}
@@ -0,0 +1,212 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// MsgpackCodec implements just enough of the MessagePack format to
+// encode/decode TempSamplePayload and TempResponsePayload as a fixmap of
+// their fields. It is not a general-purpose MessagePack implementation.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	fields, _, err := decodeMsgpackMap(data)
+	if err != nil {
+		return err
+	}
+	switch p := v.(type) {
+	case *TempSamplePayload:
+		if s, ok := fields["device_id"].(string); ok {
+			p.DeviceID = s
+		}
+		if n, ok := fields["epoch_ms"].(int64); ok {
+			p.EpochMs = n
+		}
+		if f, ok := fields["temperature"].(float64); ok {
+			p.Temperature = f
+		}
+	case *TempResponsePayload:
+		if s, ok := fields["device_id"].(string); ok {
+			p.DeviceID = s
+		}
+		if s, ok := fields["formatted_time"].(string); ok {
+			p.FormattedTime = s
+		}
+		if b, ok := fields["overtemp"].(bool); ok {
+			p.OverTemp = b
+		}
+	default:
+		return fmt.Errorf("msgpack codec: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (MsgpackCodec) Encode(w io.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	switch p := v.(type) {
+	case *TempSamplePayload:
+		encodeMsgpackMap(&buf, []msgpackEntry{
+			{"device_id", p.DeviceID},
+			{"epoch_ms", p.EpochMs},
+			{"temperature", p.Temperature},
+		})
+	case *TempResponsePayload:
+		encodeMsgpackMap(&buf, []msgpackEntry{
+			{"device_id", p.DeviceID},
+			{"formatted_time", p.FormattedTime},
+			{"overtemp", p.OverTemp},
+		})
+	default:
+		return fmt.Errorf("msgpack codec: unsupported type %T", v)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type msgpackEntry struct {
+	key   string
+	value interface{}
+}
+
+func encodeMsgpackStr(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n < 256:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	default:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	}
+	buf.WriteString(s)
+}
+
+func encodeMsgpackValue(buf *bytes.Buffer, v interface{}) {
+	switch val := v.(type) {
+	case string:
+		encodeMsgpackStr(buf, val)
+	case int64:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, val)
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(val))
+	case bool:
+		if val {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	}
+}
+
+func encodeMsgpackMap(buf *bytes.Buffer, entries []msgpackEntry) {
+	buf.WriteByte(0x80 | byte(len(entries)))
+	for _, e := range entries {
+		encodeMsgpackStr(buf, e.key)
+		encodeMsgpackValue(buf, e.value)
+	}
+}
+
+func decodeMsgpackMap(data []byte) (map[string]interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("msgpack codec: empty payload")
+	}
+	b := data[0]
+	if b&0xf0 != 0x80 {
+		return nil, nil, fmt.Errorf("msgpack codec: expected fixmap, got 0x%x", b)
+	}
+	n := int(b & 0x0f)
+	data = data[1:]
+	result := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, rest, err := decodeMsgpackString(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = rest
+		value, rest2, err := decodeMsgpackValue(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = rest2
+		result[key] = value
+	}
+	return result, data, nil
+}
+
+func decodeMsgpackString(data []byte) (string, []byte, error) {
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("msgpack codec: truncated string")
+	}
+	b := data[0]
+	switch {
+	case b&0xe0 == 0xa0:
+		n := int(b & 0x1f)
+		data = data[1:]
+		if len(data) < n {
+			return "", nil, fmt.Errorf("msgpack codec: truncated fixstr")
+		}
+		return string(data[:n]), data[n:], nil
+	case b == 0xd9:
+		if len(data) < 2 {
+			return "", nil, fmt.Errorf("msgpack codec: truncated str8 header")
+		}
+		n := int(data[1])
+		data = data[2:]
+		if len(data) < n {
+			return "", nil, fmt.Errorf("msgpack codec: truncated str8")
+		}
+		return string(data[:n]), data[n:], nil
+	case b == 0xda:
+		if len(data) < 3 {
+			return "", nil, fmt.Errorf("msgpack codec: truncated str16 header")
+		}
+		n := int(binary.BigEndian.Uint16(data[1:3]))
+		data = data[3:]
+		if len(data) < n {
+			return "", nil, fmt.Errorf("msgpack codec: truncated str16")
+		}
+		return string(data[:n]), data[n:], nil
+	default:
+		return "", nil, fmt.Errorf("msgpack codec: expected string, got 0x%x", b)
+	}
+}
+
+func decodeMsgpackValue(data []byte) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("msgpack codec: truncated value")
+	}
+	b := data[0]
+	switch {
+	case b == 0xc2:
+		return false, data[1:], nil
+	case b == 0xc3:
+		return true, data[1:], nil
+	case b == 0xd3:
+		if len(data) < 9 {
+			return nil, nil, fmt.Errorf("msgpack codec: truncated int64")
+		}
+		return int64(binary.BigEndian.Uint64(data[1:9])), data[9:], nil
+	case b == 0xcb:
+		if len(data) < 9 {
+			return nil, nil, fmt.Errorf("msgpack codec: truncated float64")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data[1:9])), data[9:], nil
+	case b&0xe0 == 0xa0 || b == 0xd9 || b == 0xda:
+		return decodeMsgpackString(data)
+	default:
+		return nil, nil, fmt.Errorf("msgpack codec: unsupported type byte 0x%x", b)
+	}
+}
@@ -0,0 +1,168 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// ProtobufCodec implements just enough of the protobuf wire format to
+// encode/decode the two fixed messages in tempsample.proto. It is not a
+// general-purpose protobuf implementation.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	fields, err := parseProtoFields(data)
+	if err != nil {
+		return err
+	}
+	switch p := v.(type) {
+	case *TempSamplePayload:
+		for _, f := range fields {
+			switch f.num {
+			case 1:
+				p.DeviceID = string(f.bytes)
+			case 2:
+				p.EpochMs = int64(f.varint)
+			case 3:
+				p.Temperature = math.Float64frombits(f.fixed64)
+			}
+		}
+	case *TempResponsePayload:
+		for _, f := range fields {
+			switch f.num {
+			case 1:
+				p.DeviceID = string(f.bytes)
+			case 2:
+				p.FormattedTime = string(f.bytes)
+			case 3:
+				p.OverTemp = f.varint != 0
+			}
+		}
+	default:
+		return fmt.Errorf("protobuf codec: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (ProtobufCodec) Encode(w io.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	switch p := v.(type) {
+	case *TempSamplePayload:
+		putString(&buf, 1, p.DeviceID)
+		putVarintField(&buf, 2, uint64(p.EpochMs))
+		putDouble(&buf, 3, p.Temperature)
+	case *TempResponsePayload:
+		putString(&buf, 1, p.DeviceID)
+		putString(&buf, 2, p.FormattedTime)
+		putBool(&buf, 3, p.OverTemp)
+	default:
+		return fmt.Errorf("protobuf codec: unsupported type %T", v)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func putVarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+func putTag(buf *bytes.Buffer, field, wireType int) {
+	putVarint(buf, uint64(field)<<3|uint64(wireType))
+}
+
+func putString(buf *bytes.Buffer, field int, s string) {
+	if s == "" {
+		return
+	}
+	putTag(buf, field, 2)
+	putVarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func putVarintField(buf *bytes.Buffer, field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	putTag(buf, field, 0)
+	putVarint(buf, v)
+}
+
+func putBool(buf *bytes.Buffer, field int, b bool) {
+	if !b {
+		return
+	}
+	putTag(buf, field, 0)
+	putVarint(buf, 1)
+}
+
+func putDouble(buf *bytes.Buffer, field int, f float64) {
+	if f == 0 {
+		return
+	}
+	putTag(buf, field, 1)
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(f))
+	buf.Write(tmp[:])
+}
+
+// protoField is one decoded (tag, value) pair; only the member matching
+// the field's wire type is populated.
+type protoField struct {
+	num      int
+	wireType int
+	varint   uint64
+	fixed64  uint64
+	bytes    []byte
+}
+
+func parseProtoFields(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("protobuf codec: bad tag")
+		}
+		data = data[n:]
+		field := protoField{num: int(tag >> 3), wireType: int(tag & 0x7)}
+		switch field.wireType {
+		case 0:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("protobuf codec: bad varint")
+			}
+			field.varint = v
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("protobuf codec: truncated fixed64")
+			}
+			field.fixed64 = binary.LittleEndian.Uint64(data[:8])
+			data = data[8:]
+		case 2:
+			l, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("protobuf codec: bad length")
+			}
+			data = data[n:]
+			if uint64(len(data)) < l {
+				return nil, fmt.Errorf("protobuf codec: truncated bytes")
+			}
+			field.bytes = data[:l]
+			data = data[l:]
+		default:
+			return nil, fmt.Errorf("protobuf codec: unsupported wire type %d", field.wireType)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
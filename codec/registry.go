@@ -0,0 +1,25 @@
+package codec
+
+import "sync"
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Codec{
+		"application/json": JSONCodec{},
+	}
+)
+
+// Register adds or replaces the codec used for contentType.
+func Register(contentType string, c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[contentType] = c
+}
+
+// Lookup returns the codec registered for contentType, if any.
+func Lookup(contentType string) (Codec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := registry[contentType]
+	return c, ok
+}
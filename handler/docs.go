@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	stdhtml "html"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultDocsPage is served when a docs request targets the root of the
+// configured tree, e.g. the bare docs URL with no sub-path.
+const DefaultDocsPage = "README.md"
+
+// docsEntry is one row of a directory listing.
+type docsEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// sanitizeDocsPath cleans the request's catch-all path and joins it onto
+// root, rejecting any path that would escape root via "..".
+func sanitizeDocsPath(root, reqPath string) (string, error) {
+	clean := path.Clean("/" + reqPath)
+	full := filepath.Join(root, clean)
+
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	fullAbs, err := filepath.Abs(full)
+	if err != nil {
+		return "", err
+	}
+	if fullAbs != rootAbs && !strings.HasPrefix(fullAbs, rootAbs+string(filepath.Separator)) {
+		return "", errors.New("docs path escapes root: " + reqPath)
+	}
+	return full, nil
+}
+
+// isBrowseAllowed reports whether dirPath (relative to root, no leading
+// or trailing slash) has opted in to directory listing via browsePaths.
+func isBrowseAllowed(browsePaths []string, dirPath string) bool {
+	dirPath = strings.Trim(dirPath, "/")
+	for _, p := range browsePaths {
+		if strings.Trim(p, "/") == dirPath {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDocsHandler serves a configurable documentation/asset tree rooted
+// at root. `.md` files are rendered to HTML via renderSections, the same
+// hook the original single-file README handler used; other files are
+// served with a Content-Type inferred from their extension; directories
+// produce a sortable HTML listing, but only for paths listed in
+// browsePaths (directory browsing is opt-in, not on by default).
+//
+// The handler is meant to be registered twice: once at the bare docs
+// URL (for DefaultDocsPage) and once at the same URL plus "/*filepath"
+// (for everything else under root).
+func NewDocsHandler(log Logger, root string, browsePaths []string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		log.Infof("Received Docs request: %+v", r)
+		if err := r.Context().Err(); err != nil {
+			ErrorHandler("Error: request deadline exceeded before reading docs",
+				err, http.StatusBadRequest, log, w)
+			return
+		}
+
+		reqPath := p.ByName("filepath")
+		if reqPath == "" || reqPath == "/" {
+			reqPath = "/" + DefaultDocsPage
+		}
+
+		fullPath, err := sanitizeDocsPath(root, reqPath)
+		if err != nil {
+			ErrorHandler("Error: invalid docs path", err, http.StatusBadRequest, log, w)
+			return
+		}
+
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			ErrorHandler("Error: docs path not found: "+reqPath,
+				err, http.StatusNotFound, log, w)
+			return
+		}
+
+		if info.IsDir() {
+			relDir := strings.TrimPrefix(path.Clean("/"+reqPath), "/")
+			serveDocsDir(log, w, r, fullPath, relDir, browsePaths)
+			return
+		}
+
+		serveDocsFile(log, w, fullPath)
+	}
+}
+
+func serveDocsFile(log Logger, w http.ResponseWriter, fullPath string) {
+	data, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		ErrorHandler("Error reading docs file", err, http.StatusInternalServerError, log, w)
+		return
+	}
+
+	if strings.EqualFold(filepath.Ext(fullPath), ".md") {
+		opts := html.RendererOptions{
+			Flags:          html.CommonFlags,
+			RenderNodeHook: renderSections,
+		}
+		renderer := html.NewRenderer(opts)
+		w.Header().Set(ContentTypeKey, ContentTypeHTML)
+		rendered := markdown.ToHTML(data, nil, renderer)
+		if respCode, err := w.Write(rendered); err != nil {
+			log.Errorf("Error writing response (%d): error: %s", respCode, err)
+		}
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(fullPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set(ContentTypeKey, contentType)
+	if respCode, err := w.Write(data); err != nil {
+		log.Errorf("Error writing response (%d): error: %s", respCode, err)
+	}
+}
+
+func serveDocsDir(log Logger, w http.ResponseWriter, r *http.Request, fullPath, relDir string, browsePaths []string) {
+	if !isBrowseAllowed(browsePaths, relDir) {
+		ErrorHandler("Error: directory browsing not enabled for this path",
+			errors.New("browsing disabled: "+relDir), http.StatusForbidden, log, w)
+		return
+	}
+
+	dirEntries, err := ioutil.ReadDir(fullPath)
+	if err != nil {
+		ErrorHandler("Error reading docs directory", err, http.StatusInternalServerError, log, w)
+		return
+	}
+
+	entries := make([]docsEntry, 0, len(dirEntries))
+	for _, e := range dirEntries {
+		entries = append(entries, docsEntry{
+			Name:    e.Name(),
+			Size:    e.Size(),
+			ModTime: e.ModTime(),
+			IsDir:   e.IsDir(),
+		})
+	}
+	sortDocsEntries(entries, r.URL.Query().Get("sort"), r.URL.Query().Get("order"))
+
+	w.Header().Set(ContentTypeKey, ContentTypeHTML)
+	respCode, err := w.Write(renderDocsListing(r.URL.Path, relDir, entries))
+	if err != nil {
+		log.Errorf("Error writing response (%d): error: %s", respCode, err)
+	}
+}
+
+// renderDocsListing renders a directory listing as a minimal HTML table:
+// name (linked), humanized size, and mod time. requestPath is
+// r.URL.Path for this request (e.g. "/docs/assets/"); links are built
+// relative to it, not to "/", so the listing works however the docs
+// handler is mounted (config.ReadmeURL need not be "/").
+func renderDocsListing(requestPath, relDir string, entries []docsEntry) []byte {
+	base := requestPath
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<html><body><h1>Index of /" + stdhtml.EscapeString(relDir) + "</h1><table>\n")
+	buf.WriteString("<tr><th>Name</th><th>Size</th><th>Modified</th></tr>\n")
+	for _, e := range entries {
+		name := e.Name
+		if e.IsDir {
+			name += "/"
+		}
+		href := base + e.Name
+		buf.WriteString("<tr><td><a href=\"" + stdhtml.EscapeString(href) + "\">" +
+			stdhtml.EscapeString(name) + "</a></td><td>" + humanizeSize(e.Size) +
+			"</td><td>" + e.ModTime.Format(TimeLayout) + "</td></tr>\n")
+	}
+	buf.WriteString("</table></body></html>")
+	return buf.Bytes()
+}
+
+// sortDocsEntries sorts entries in place by the `sort` key (name|size|
+// time, default name) and `order` (asc|desc, default asc).
+func sortDocsEntries(entries []docsEntry, sortKey, order string) {
+	less := func(i, j int) bool {
+		switch sortKey {
+		case "size":
+			return entries[i].Size < entries[j].Size
+		case "time":
+			return entries[i].ModTime.Before(entries[j].ModTime)
+		default:
+			return entries[i].Name < entries[j].Name
+		}
+	}
+	if order == "desc" {
+		asc := less
+		less = func(i, j int) bool { return asc(j, i) }
+	}
+	sort.Slice(entries, less)
+}
+
+// humanizeSize renders n bytes as a short human-readable size, e.g.
+// "1.5 KB", for the directory listing.
+func humanizeSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(n)/float64(div), 'f', 1, 64) + " " + string("KMGTPE"[exp]) + "B"
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocsHandler(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "README.md"), []byte("# Title\nbody"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes.md"), []byte("# Notes\nmore"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "style.css"), []byte("body{}"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "assets"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "assets", "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "secret"), 0755))
+
+	docsHandler := NewDocsHandler(logger, root, []string{"assets"})
+
+	// Default page (no sub-path) renders README.md as HTML.
+	req := httptest.NewRequest(http.MethodGet, "/readme", nil)
+	resp := GetTestResponseWithHandler(req, http.MethodGet, "/readme", docsHandler)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, ContentTypeHTML, resp.Header.Get(ContentTypeKey))
+
+	// A linked markdown page under the root also renders to HTML.
+	req = httptest.NewRequest(http.MethodGet, "/readme/notes.md", nil)
+	resp = GetTestResponseWithHandler(req, http.MethodGet, "/readme/*filepath", docsHandler)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, ContentTypeHTML, resp.Header.Get(ContentTypeKey))
+
+	// Non-markdown assets are served with an inferred Content-Type.
+	req = httptest.NewRequest(http.MethodGet, "/readme/style.css", nil)
+	resp = GetTestResponseWithHandler(req, http.MethodGet, "/readme/*filepath", docsHandler)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, "body{}", string(body))
+
+	// Directories not opted in to browsing are forbidden.
+	req = httptest.NewRequest(http.MethodGet, "/readme/secret/", nil)
+	resp = GetTestResponseWithHandler(req, http.MethodGet, "/readme/*filepath", docsHandler)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Directories that are opted in list their contents.
+	req = httptest.NewRequest(http.MethodGet, "/readme/assets/", nil)
+	resp = GetTestResponseWithHandler(req, http.MethodGet, "/readme/*filepath", docsHandler)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ = io.ReadAll(resp.Body)
+	require.Contains(t, string(body), "a.txt")
+	// The listing is mounted at "/readme", not "/" — links must be built
+	// relative to that mount point or they 404.
+	require.Contains(t, string(body), `href="/readme/assets/a.txt"`)
+
+	// ".." traversal attempts are rejected.
+	req = httptest.NewRequest(http.MethodGet, "/readme/../../etc/passwd", nil)
+	resp = GetTestResponseWithHandler(req, http.MethodGet, "/readme/*filepath", docsHandler)
+	require.NotEqual(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorRecord is one rejected device payload.
+type ErrorRecord struct {
+	ID        uint64    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	DeviceID  string    `json:"device_id,omitempty"`
+	Payload   string    `json:"raw_payload"`
+	Reason    string    `json:"reason"`
+}
+
+// QueryOptions filters and pages an ErrorStore.Query call.
+type QueryOptions struct {
+	// Since, if non-zero, excludes records older than this time.
+	Since time.Time
+	// Offset skips this many matching records before collecting results.
+	Offset int
+	// Limit caps the number of records returned; 0 means no limit.
+	Limit int
+}
+
+// ClearOptions scopes an ErrorStore.Clear call to a subset of records. The
+// zero value clears everything.
+type ClearOptions struct {
+	// FromID/ToID, when ToID is non-zero, restrict the clear to records
+	// with FromID <= ID <= ToID.
+	FromID uint64
+	ToID   uint64
+	// Since/Until, when Until is non-zero, restrict the clear to records
+	// with Since <= Timestamp <= Until.
+	Since time.Time
+	Until time.Time
+}
+
+func (c ClearOptions) isZero() bool {
+	return c.ToID == 0 && c.Until.IsZero()
+}
+
+func (c ClearOptions) matches(r ErrorRecord) bool {
+	if c.ToID != 0 && (r.ID < c.FromID || r.ID > c.ToID) {
+		return false
+	}
+	if !c.Until.IsZero() && (r.Timestamp.Before(c.Since) || r.Timestamp.After(c.Until)) {
+		return false
+	}
+	return true
+}
+
+// ErrorStore persists rejected device payloads for later inspection,
+// optionally bounded in size, and can be queried with pagination.
+type ErrorStore interface {
+	// Push records a rejected payload with the reason it was rejected and
+	// returns the assigned record.
+	Push(payload, reason string) ErrorRecord
+	// Query returns records matching opts, oldest first.
+	Query(opts QueryOptions) []ErrorRecord
+	// Clear removes records matching opts (or everything, for the zero
+	// value) and returns the number removed.
+	Clear(opts ClearOptions) int
+	// Len returns the current number of stored records.
+	Len() int
+}
+
+// extractDeviceID pulls a leading `device_id:` prefix out of a raw
+// telemetry payload, the way parseTempSample would, without requiring the
+// rest of the payload to be well formed. Returns "" if none is found.
+func extractDeviceID(payload string) string {
+	idx := strings.Index(payload, ":")
+	if idx <= 0 {
+		return ""
+	}
+	candidate := payload[:idx]
+	if _, err := strconv.ParseInt(candidate, 10, 64); err != nil {
+		return ""
+	}
+	return candidate
+}
+
+func applyQuery(records []ErrorRecord, opts QueryOptions) []ErrorRecord {
+	filtered := make([]ErrorRecord, 0, len(records))
+	for _, r := range records {
+		if !opts.Since.IsZero() && r.Timestamp.Before(opts.Since) {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+
+	if opts.Offset > 0 {
+		if opts.Offset >= len(filtered) {
+			return []ErrorRecord{}
+		}
+		filtered = filtered[opts.Offset:]
+	}
+	if opts.Limit > 0 && opts.Limit < len(filtered) {
+		filtered = filtered[:opts.Limit]
+	}
+	return filtered
+}
+
+// MemoryErrorStore is an in-memory ring buffer of the most recent MaxSize
+// records; once full, pushing a new record evicts the oldest one.
+type MemoryErrorStore struct {
+	mu      sync.Mutex
+	maxSize int
+	nextID  uint64
+	records []ErrorRecord
+}
+
+// NewMemoryErrorStore creates a ring buffer retaining at most maxSize
+// records. maxSize <= 0 means unbounded, matching the old behavior.
+func NewMemoryErrorStore(maxSize int) *MemoryErrorStore {
+	return &MemoryErrorStore{maxSize: maxSize}
+}
+
+func (s *MemoryErrorStore) Push(payload, reason string) ErrorRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	record := ErrorRecord{
+		ID:        s.nextID,
+		Timestamp: time.Now(),
+		DeviceID:  extractDeviceID(payload),
+		Payload:   payload,
+		Reason:    reason,
+	}
+	s.records = append(s.records, record)
+	if s.maxSize > 0 && len(s.records) > s.maxSize {
+		s.records = s.records[len(s.records)-s.maxSize:]
+	}
+	return record
+}
+
+func (s *MemoryErrorStore) Query(opts QueryOptions) []ErrorRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return applyQuery(s.records, opts)
+}
+
+func (s *MemoryErrorStore) Clear(opts ClearOptions) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.isZero() {
+		removed := len(s.records)
+		s.records = nil
+		return removed
+	}
+
+	kept := s.records[:0:0]
+	removed := 0
+	for _, r := range s.records {
+		if opts.matches(r) {
+			removed++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.records = kept
+	return removed
+}
+
+func (s *MemoryErrorStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
+
+// FileErrorStore is a JSONL-backed store that survives restarts: every
+// push is written to disk immediately (appended, or the whole file
+// rewritten when the push evicts a record), and an in-memory index (subject
+// to the same maxSize retention as MemoryErrorStore) is kept for fast
+// Query/Len/Clear. The on-disk file is reloaded on construction.
+type FileErrorStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	maxSize int
+	nextID  uint64
+	records []ErrorRecord
+}
+
+// NewFileErrorStore opens (creating if necessary) the JSONL file at path
+// and replays its contents to rebuild the in-memory index. maxSize <= 0
+// means unbounded retention.
+func NewFileErrorStore(path string, maxSize int) (*FileErrorStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileErrorStore{path: path, file: f, maxSize: maxSize}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record ErrorRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		store.records = append(store.records, record)
+		if record.ID > store.nextID {
+			store.nextID = record.ID
+		}
+	}
+	if maxSize > 0 && len(store.records) > maxSize {
+		store.records = store.records[len(store.records)-maxSize:]
+	}
+
+	return store, nil
+}
+
+func (s *FileErrorStore) Push(payload, reason string) ErrorRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	record := ErrorRecord{
+		ID:        s.nextID,
+		Timestamp: time.Now(),
+		DeviceID:  extractDeviceID(payload),
+		Payload:   payload,
+		Reason:    reason,
+	}
+
+	s.records = append(s.records, record)
+	if s.maxSize > 0 && len(s.records) > s.maxSize {
+		// Eviction trimmed the in-memory index, so the appended line
+		// alone would leave the file holding more than maxSize records
+		// forever; rewrite it to match instead of just appending.
+		s.records = s.records[len(s.records)-s.maxSize:]
+		s.rewriteLocked()
+	} else if line, err := json.Marshal(record); err == nil {
+		s.file.Write(append(line, '\n'))
+	}
+	return record
+}
+
+func (s *FileErrorStore) Query(opts QueryOptions) []ErrorRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return applyQuery(s.records, opts)
+}
+
+func (s *FileErrorStore) Clear(opts ClearOptions) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []ErrorRecord
+	removed := 0
+	for _, r := range s.records {
+		if opts.isZero() || opts.matches(r) {
+			removed++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.records = kept
+
+	if err := s.rewriteLocked(); err != nil {
+		return removed
+	}
+	return removed
+}
+
+// rewriteLocked rewrites the backing file to hold exactly s.records. The
+// caller must hold s.mu.
+func (s *FileErrorStore) rewriteLocked() error {
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, 0); err != nil {
+		return err
+	}
+	for _, r := range s.records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			continue
+		}
+		if _, err := s.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileErrorStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryErrorStoreEvictsOldestOnceOverMaxSize(t *testing.T) {
+	store := NewMemoryErrorStore(2)
+
+	store.Push("a", "r")
+	store.Push("b", "r")
+	store.Push("c", "r")
+
+	require.Equal(t, 2, store.Len())
+	records := store.Query(QueryOptions{})
+	require.Len(t, records, 2)
+	require.Equal(t, "b", records[0].Payload, "oldest record should have been evicted")
+	require.Equal(t, "c", records[1].Payload)
+}
+
+func TestMemoryErrorStoreQueryFiltersAndPages(t *testing.T) {
+	store := NewMemoryErrorStore(0)
+
+	store.Push("a", "r")
+	midpoint := time.Now()
+	store.Push("b", "r")
+	store.Push("c", "r")
+	store.Push("d", "r")
+
+	since := store.Query(QueryOptions{Since: midpoint})
+	require.Len(t, since, 3)
+	require.Equal(t, "b", since[0].Payload)
+
+	paged := store.Query(QueryOptions{Offset: 1, Limit: 2})
+	require.Len(t, paged, 2)
+	require.Equal(t, "b", paged[0].Payload)
+	require.Equal(t, "c", paged[1].Payload)
+
+	beyondEnd := store.Query(QueryOptions{Offset: 10})
+	require.Empty(t, beyondEnd)
+}
+
+func TestMemoryErrorStoreClearByIDRangeAndTimeWindow(t *testing.T) {
+	store := NewMemoryErrorStore(0)
+
+	a := store.Push("a", "r")
+	_ = store.Push("b", "r")
+	cutoff := time.Now()
+	_ = store.Push("c", "r")
+	_ = store.Push("d", "r")
+
+	removed := store.Clear(ClearOptions{FromID: a.ID, ToID: a.ID})
+	require.Equal(t, 1, removed)
+	require.Equal(t, 3, store.Len())
+
+	removed = store.Clear(ClearOptions{Since: cutoff, Until: time.Now()})
+	require.Equal(t, 2, removed, "should remove both records created after cutoff")
+	remaining := store.Query(QueryOptions{})
+	require.Len(t, remaining, 1)
+	require.Equal(t, "b", remaining[0].Payload)
+}
+
+func TestFileErrorStoreRoundTripsThroughRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.jsonl")
+
+	store, err := NewFileErrorStore(path, 0)
+	require.NoError(t, err)
+	store.Push("a", "r")
+	store.Push("b", "r")
+
+	reopened, err := NewFileErrorStore(path, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, reopened.Len())
+	records := reopened.Query(QueryOptions{})
+	require.Equal(t, "a", records[0].Payload)
+	require.Equal(t, "b", records[1].Payload)
+}
+
+func TestFileErrorStorePrunesBackingFileOnEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.jsonl")
+
+	store, err := NewFileErrorStore(path, 2)
+	require.NoError(t, err)
+	store.Push("a", "r")
+	store.Push("b", "r")
+	store.Push("c", "r")
+
+	require.Equal(t, 2, store.Len())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := 0
+	for _, b := range data {
+		if b == '\n' {
+			lines++
+		}
+	}
+	require.Equal(t, 2, lines, "backing file should be pruned to match the in-memory index: %q", data)
+
+	reopened, err := NewFileErrorStore(path, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, reopened.Len())
+	records := reopened.Query(QueryOptions{})
+	require.Equal(t, "b", records[0].Payload)
+	require.Equal(t, "c", records[1].Payload)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Level is a logging severity, ordered so that a lower value is more
+// verbose than a higher one.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Logger is the leveled logging interface handlers depend on, in place
+// of calling *log.Logger.Printf directly.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// StructuredLogger is a Logger that writes through a stdlib *log.Logger,
+// either as plain `LEVEL: message` lines or as one JSON object per line.
+type StructuredLogger struct {
+	out   *log.Logger
+	level Level
+	json  bool
+}
+
+// NewStructuredLogger wraps out, suppressing anything below level and
+// optionally emitting JSON lines instead of plain text.
+func NewStructuredLogger(out *log.Logger, level Level, jsonOutput bool) *StructuredLogger {
+	return &StructuredLogger{out: out, level: level, json: jsonOutput}
+}
+
+type logEntry struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+func (l *StructuredLogger) emit(level Level, format string, args []interface{}) {
+	if level < l.level {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if l.json {
+		entry := logEntry{
+			Time:  time.Now().Format(time.RFC3339),
+			Level: level.String(),
+			Msg:   msg,
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			l.out.Printf("%s: %s", level, msg)
+			return
+		}
+		l.out.Output(3, string(b))
+		return
+	}
+	l.out.Output(3, fmt.Sprintf("%s: %s", level, msg))
+}
+
+func (l *StructuredLogger) Debugf(format string, args ...interface{}) {
+	l.emit(LevelDebug, format, args)
+}
+
+func (l *StructuredLogger) Infof(format string, args ...interface{}) {
+	l.emit(LevelInfo, format, args)
+}
+
+func (l *StructuredLogger) Errorf(format string, args ...interface{}) {
+	l.emit(LevelError, format, args)
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// latencyBuckets are the histogram bucket boundaries, in seconds, used
+// for per-route request latency.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	buckets []float64
+	sum     float64
+	count   float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: make([]float64, len(latencyBuckets))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	h.sum += seconds
+	h.count++
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+}
+
+type requestKey struct {
+	route  string
+	method string
+	status int
+}
+
+// Metrics holds the counters and histograms exposed at /metrics in
+// Prometheus text exposition format: request counts by route/method/
+// status, request latency by route, temperature parse failures, and the
+// set of devices currently reporting over-temp.
+type Metrics struct {
+	mu                sync.Mutex
+	requestsTotal     map[requestKey]float64
+	requestLatency    map[string]*histogram
+	tempParseFailures float64
+	overTempDevices   map[string]struct{}
+}
+
+// NewMetrics creates an empty metrics registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requestsTotal:   make(map[requestKey]float64),
+		requestLatency:  make(map[string]*histogram),
+		overTempDevices: make(map[string]struct{}),
+	}
+}
+
+// ObserveRequest records one completed request against route.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requestsTotal[requestKey{route: route, method: method, status: status}]++
+	h, ok := m.requestLatency[route]
+	if !ok {
+		h = newHistogram()
+		m.requestLatency[route] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// IncTempParseFailure records one temperature payload that failed to
+// parse or decode (parseTempSample, a codec, or a malformed stream frame).
+func (m *Metrics) IncTempParseFailure() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tempParseFailures++
+}
+
+// MarkOverTemp records that deviceID is currently reporting over-temp.
+func (m *Metrics) MarkOverTemp(deviceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overTempDevices[deviceID] = struct{}{}
+}
+
+// MarkNormal records that deviceID is back under the temp threshold.
+func (m *Metrics) MarkNormal(deviceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.overTempDevices, deviceID)
+}
+
+// WriteProm renders the registry, plus the given error store size, in
+// Prometheus text exposition format.
+func (m *Metrics) WriteProm(w http.ResponseWriter, errorStoreSize int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP simple_http_server_requests_total Total HTTP requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE simple_http_server_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requestsTotal))
+	for k := range m.requestsTotal {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "simple_http_server_requests_total{route=%q,method=%q,status=\"%d\"} %v\n",
+			k.route, k.method, k.status, m.requestsTotal[k])
+	}
+
+	fmt.Fprintln(w, "# HELP simple_http_server_request_duration_seconds Request latency by route.")
+	fmt.Fprintln(w, "# TYPE simple_http_server_request_duration_seconds histogram")
+	routes := make([]string, 0, len(m.requestLatency))
+	for route := range m.requestLatency {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		h := m.requestLatency[route]
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(w, "simple_http_server_request_duration_seconds_bucket{route=%q,le=%q} %v\n",
+				route, strconv.FormatFloat(le, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "simple_http_server_request_duration_seconds_bucket{route=%q,le=\"+Inf\"} %v\n", route, h.count)
+		fmt.Fprintf(w, "simple_http_server_request_duration_seconds_sum{route=%q} %v\n", route, h.sum)
+		fmt.Fprintf(w, "simple_http_server_request_duration_seconds_count{route=%q} %v\n", route, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP simple_http_server_temp_parse_failures_total Temperature payloads that failed to parse.")
+	fmt.Fprintln(w, "# TYPE simple_http_server_temp_parse_failures_total counter")
+	fmt.Fprintf(w, "simple_http_server_temp_parse_failures_total %v\n", m.tempParseFailures)
+
+	fmt.Fprintln(w, "# HELP simple_http_server_over_temp_devices Current number of devices reporting over-temp.")
+	fmt.Fprintln(w, "# TYPE simple_http_server_over_temp_devices gauge")
+	fmt.Fprintf(w, "simple_http_server_over_temp_devices %v\n", len(m.overTempDevices))
+
+	fmt.Fprintln(w, "# HELP simple_http_server_error_store_size Current number of records held in the error store.")
+	fmt.Fprintln(w, "# TYPE simple_http_server_error_store_size gauge")
+	fmt.Fprintf(w, "simple_http_server_error_store_size %v\n", errorStoreSize)
+}
+
+// MetricsHandler is the handler for GET /metrics.
+func MetricsHandler(log Logger, metrics *Metrics, store ErrorStore) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		log.Debugf("Received Metrics request: %+v", r)
+		w.Header().Set(ContentTypeKey, "text/plain; version=0.0.4")
+		metrics.WriteProm(w, store.Len())
+	}
+}
+
+// statusRecorder captures the status code a wrapped handler writes, so
+// InstrumentRoute can label requestsTotal by outcome.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// InstrumentRoute wraps h so every call is recorded in metrics under the
+// given route label, by method and final status code, with latency.
+func InstrumentRoute(route string, metrics *Metrics, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		h(rec, r, p)
+		metrics.ObserveRequest(route, r.Method, rec.status, time.Since(start))
+	}
+}
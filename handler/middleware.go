@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// deadlineExceededResponse is the structured body returned when a
+// WithDeadline-wrapped handler doesn't finish in time.
+type deadlineExceededResponse struct {
+	Error   string `json:"error"`
+	Timeout string `json:"timeout"`
+}
+
+func writeDeadlineExceeded(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set(ContentTypeKey, ContentTypeJSON)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	body, _ := json.Marshal(deadlineExceededResponse{
+		Error:   "request exceeded handler deadline",
+		Timeout: d.String(),
+	})
+	w.Write(body)
+}
+
+// guardedResponseWriter lets WithDeadline hand the wrapped handler a
+// ResponseWriter that can be safely raced against the deadline path: the
+// first of {the handler, the deadline timeout} to attempt a write wins
+// and proceeds to the real http.ResponseWriter, and the other's writes
+// are silently dropped instead of landing on the same connection.
+type guardedResponseWriter struct {
+	http.ResponseWriter
+	mu          sync.Mutex
+	committed   bool
+	handlerOwns bool
+}
+
+// claimHandler reports whether the handler side may write: true the
+// first time it's called (possibly by a timeout that beat it there,
+// which returns false here), and on every call after a handler write has
+// already been claimed (so later writes from the same handler still go
+// through normally).
+func (g *guardedResponseWriter) claimHandler() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.committed {
+		g.committed = true
+		g.handlerOwns = true
+	}
+	return g.handlerOwns
+}
+
+// claimTimeout reports whether the deadline path may write the 503; it
+// only succeeds if nothing — including the handler — has written yet.
+func (g *guardedResponseWriter) claimTimeout() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.committed {
+		return false
+	}
+	g.committed = true
+	return true
+}
+
+func (g *guardedResponseWriter) WriteHeader(status int) {
+	if !g.claimHandler() {
+		return
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *guardedResponseWriter) Write(b []byte) (int, error) {
+	if !g.claimHandler() {
+		return len(b), nil
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// WithDeadline wraps h so r.Context() is cancelled after d, and so a
+// handler that hasn't written a response by then gets a 503 with a
+// structured error body instead of tying up the connection indefinitely.
+// d <= 0 disables the deadline and returns h unwrapped.
+//
+// h runs in its own goroutine so the deadline can fire even if h ignores
+// r.Context() and keeps running; h is given a guardedResponseWriter so
+// that if it eventually does write, after the 503 has already been sent,
+// that write is dropped instead of racing the deadline path on the same
+// underlying http.ResponseWriter.
+//
+// The cancellation itself follows the same cancel-channel-plus-AfterFunc
+// shape as context.WithTimeout, spelled out here so callers (tests, in
+// particular) can set very short deadlines and observe the cancellation
+// path directly.
+func WithDeadline(h httprouter.Handle, d time.Duration) httprouter.Handle {
+	if d <= 0 {
+		return h
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		timer := time.AfterFunc(d, cancel)
+		defer timer.Stop()
+
+		gw := &guardedResponseWriter{ResponseWriter: w}
+
+		done := make(chan struct{})
+		go func() {
+			h(gw, r.WithContext(ctx), p)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if gw.claimTimeout() {
+				writeDeadlineExceeded(gw.ResponseWriter, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDeadline(t *testing.T) {
+	slowHandler := httprouter.Handle(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+
+	wrapped := WithDeadline(slowHandler, 5*time.Millisecond)
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	resp := GetTestResponseWithHandler(req, http.MethodGet, "/slow", wrapped)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "should time out")
+
+	fastHandler := httprouter.Handle(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrapped = WithDeadline(fastHandler, time.Second)
+	req = httptest.NewRequest(http.MethodGet, "/fast", nil)
+	resp = GetTestResponseWithHandler(req, http.MethodGet, "/fast", wrapped)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "should not time out")
+
+	noDeadline := WithDeadline(fastHandler, 0)
+	req = httptest.NewRequest(http.MethodGet, "/fast", nil)
+	resp = GetTestResponseWithHandler(req, http.MethodGet, "/fast", noDeadline)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "zero deadline disables wrapping")
+}
+
+// TestWithDeadlineDropsLateWriteFromIgnoredContext covers a handler that
+// ignores r.Context() entirely and writes after the deadline has already
+// fired: the late write must be dropped, not appended to (or racing)
+// the 503 response already sent.
+func TestWithDeadlineDropsLateWriteFromIgnoredContext(t *testing.T) {
+	lateWriteDone := make(chan struct{})
+	ignoresContext := httprouter.Handle(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		defer close(lateWriteDone)
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte("late"))
+	})
+
+	wrapped := WithDeadline(ignoresContext, 5*time.Millisecond)
+	router := httprouter.New()
+	router.GET("/slow", wrapped)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code, "should time out")
+
+	<-lateWriteDone // wait for the handler's late write attempt to complete
+	require.NotContains(t, rec.Body.String(), "late",
+		"late write from a handler that ignores the context must not reach the response")
+}
@@ -1,33 +1,35 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"regexp"
 	"runtime/debug"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/gomarkdown/markdown"
+	"app/codec"
+
 	"github.com/gomarkdown/markdown/ast"
-	"github.com/gomarkdown/markdown/html"
 	"github.com/julienschmidt/httprouter"
 )
 
 // Error codes
 const (
-	ContentTypeKey     = "Content-Type"
-	ContentTypeJSON    = "application/json"
-	ContentTypeHTML    = "text/html"
-	InvalidContentType = "invalid content type"
-	TempThreshold      = 90.0
+	ContentTypeKey      = "Content-Type"
+	ContentTypeJSON     = "application/json"
+	ContentTypeHTML     = "text/html"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeMsgpack  = "application/x-msgpack"
+	AcceptKey           = "Accept"
+	InvalidContentType  = "invalid content type"
+	TempThreshold       = 90.0
 	// `%Y/%m/%d %H:%M:%S`
 	TimeLayout = "2006/01/02 15:04:05"
 )
@@ -105,8 +107,14 @@ func renderSections(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus,
 	return ast.GoToNext, false
 }
 
-// EpochStrToFormatted converts epoch string to formatted string.
-func EpochStrToFormatted(epochStr string) (string, error) {
+// EpochStrToFormatted converts epoch string to formatted string. It
+// checks ctx for cancellation before doing the (cheap, but
+// request-scoped) conversion work.
+func EpochStrToFormatted(ctx context.Context, epochStr string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	epoch, err := strconv.ParseInt(epochStr, 10, 64)
 	if err != nil || epoch == 0 {
 		return "", errors.New("Invalid utime for conversion")
@@ -123,25 +131,25 @@ func errorHandler(
 	reasonErrMsg error,
 	httpErrorStatus int,
 	traceID string,
-	log *log.Logger,
+	log Logger,
 	w http.ResponseWriter,
 ) {
 	var logError = errMsg
 	if reasonErrMsg != nil {
 		logError = fmt.Sprintf("%s Reason: %v", errMsg, reasonErrMsg)
 	}
-	log.Printf("Err: %s", logError)
+	log.Errorf("Err: %s", logError)
 	http.Error(w, errMsg, httpErrorStatus)
 }
 
 // ErrorHandler prints the error message and returns the error status.
 func ErrorHandler(errMsg string, reasonErrMsg error, httpErrorStatus int,
-	log *log.Logger, w http.ResponseWriter) {
+	log Logger, w http.ResponseWriter) {
 	var logError = errMsg
 	if reasonErrMsg != nil {
 		logError = fmt.Sprintf("%s Reason: %v", errMsg, reasonErrMsg)
 	}
-	log.Printf("Error: %s", logError)
+	log.Errorf("Error: %s", logError)
 	http.Error(w, errMsg, httpErrorStatus)
 }
 
@@ -179,195 +187,260 @@ type NormalTempResponse struct {
 	OverTemp bool `json:"overtemp"`
 }
 
-var myErrorStrings = errorStrings{
-	errors: make([]string, 0),
+// TempSample is a single device temperature reading, however it arrived
+// (POST body or stream frame).
+type TempSample struct {
+	DeviceID      string
+	FormattedTime string
+	Temperature   float64
 }
 
-type errorStrings struct {
-	sync.Mutex
-	errors []string
-}
+// parseTempSample parses the bespoke colon-delimited payload carried in the
+// `data` field of a temp request:
+// - `__device_id__:__epoch_ms__:'Temperature':__temperature__`
+// - `__device_id__` is the device ID (int32)
+// - `__epoch_ms__` is the timestamp in EpochMS (int64)
+// - `__temperature__` is the temperature (float64)
+// - Example `"365951380:1640995229697:'Temperature':58.48256793121914"`
+//
+// It is shared by PostTempHandler and StreamTempHandler so the
+// threshold/validation logic stays consistent across both paths.
+func parseTempSample(ctx context.Context, data string) (*TempSample, error) {
+	var tempString string
+	var containsTemp bool
+	if strings.Contains(data, ":Temperature:") {
+		containsTemp = true
+		tempString = ":Temperature:"
+	}
 
-func (e *errorStrings) Push(str string) {
-	e.Lock()
-	defer e.Unlock()
-	e.errors = append(e.errors, str)
-}
+	if strings.Contains(data, ":'Temperature':") {
+		containsTemp = true
+		tempString = ":'Temperature':"
+	}
 
-func (e *errorStrings) Get() []string {
-	e.Lock()
-	defer e.Unlock()
-	return e.errors
-}
+	if strings.Contains(data, `":\'Temperature:\'"`) {
+		containsTemp = true
+		tempString = ":'Temperature':"
+	}
+	if !containsTemp {
+		return nil, errors.New("No temperature keyword")
+	}
 
-func (e *errorStrings) Len() int {
-	e.Lock()
-	defer e.Unlock()
-	return len(e.errors)
-}
+	fields := strings.Split(data, tempString)
+	if len(fields) != 2 {
+		return nil, errors.New("Wrong format temp fields")
+	}
+
+	deviceFields := strings.Split(fields[0], ":")
+	if len(deviceFields) != 2 {
+		return nil, errors.New("Wrong format: device fields")
+	}
+
+	deviceID := deviceFields[0]
+	formatT, errF := EpochStrToFormatted(ctx, deviceFields[1])
+	if errF != nil {
+		return nil, errors.New("Wrong format: epoch time")
+	}
+	temp, errP := strconv.ParseFloat(fields[1], 64)
+	if errP != nil {
+		return nil, errors.New("Wrong format: parse float")
+	}
 
-func (e *errorStrings) Clear() {
-	e.Lock()
-	defer e.Unlock()
-	e.errors = []string{}
+	return &TempSample{
+		DeviceID:      deviceID,
+		FormattedTime: formatT,
+		Temperature:   temp,
+	}, nil
 }
 
-// PostTempHandler is the handler for POST /temp
-// Sample request body:
+// PostTempHandler is the handler for POST /temp. The legacy JSON shape
+// remains exactly as before:
 // `{"data": __data_string__}`
 // - `__device_id__:__epoch_ms__:'Temperature':__temperature__`
 // - `__device_id__` is the device ID (int32)
 // - `__epoch_ms__` is the timestamp in EpochMS (int64)
 // - `__temperature__` is the temperature (float64)
 // - Example `{"data": "365951380:1640995229697:'Temperature':58.48256793121914"}`
-func PostTempHandler(log *log.Logger) httprouter.Handle {
+//
+// A device may instead send a codec.TempSamplePayload (device_id/
+// epoch_ms/temperature as real fields, no embedded string) by setting
+// Content-Type to a codec registered via codec.Register, e.g.
+// ContentTypeProtobuf or ContentTypeMsgpack. The response is JSON unless
+// the request's Accept header names a registered codec.
+func PostTempHandler(log Logger, store ErrorStore, metrics *Metrics) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		log.Printf("Received PostTemp request: %+v", r)
+		log.Infof("Received PostTemp request: %+v", r)
 
-		if r.Header.Get(ContentTypeKey) != ContentTypeJSON {
-			ErrorHandler("Error: request header missing "+ContentTypeKey,
-				errors.New(InvalidContentType), http.StatusBadRequest, log, w)
+		if err := r.Context().Err(); err != nil {
+			ErrorHandler("Error: request deadline exceeded before decoding",
+				err, http.StatusBadRequest, log, w)
 			return
 		}
+
 		badReqRet := `{"error": "bad request"}`
-		var params map[string]string
-		var err error
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&params); err != nil {
-			ErrorHandler(badReqRet,
-				err, http.StatusBadRequest, log, w)
-			b, _ := io.ReadAll(r.Body)
-			if b != nil {
-				myErrorStrings.Push(string(b))
+		contentType := r.Header.Get(ContentTypeKey)
+
+		var sample *TempSample
+		switch contentType {
+		case ContentTypeJSON, "":
+			var params map[string]string
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&params); err != nil {
+				ErrorHandler(badReqRet,
+					err, http.StatusBadRequest, log, w)
+				b, _ := io.ReadAll(r.Body)
+				if b != nil {
+					store.Push(string(b), err.Error())
+				}
+				return
 			}
-			return
-		}
 
-		data, ok := params["data"]
-		if !ok || len(data) == 0 {
-			ErrorHandler(badReqRet,
-				errors.New("Got empty data"),
-				http.StatusBadRequest, log, w)
-			myErrorStrings.Push(data)
-			return
-		}
+			data, ok := params["data"]
+			if !ok || len(data) == 0 {
+				reasonErr := errors.New("Got empty data")
+				ErrorHandler(badReqRet,
+					reasonErr,
+					http.StatusBadRequest, log, w)
+				store.Push(data, reasonErr.Error())
+				return
+			}
 
-		//  Check temp range
-		var tempString string
-		var containsTemp bool
-		if strings.Contains(data, ":Temperature:") {
-			containsTemp = true
-			tempString = ":Temperature:"
-		}
+			var errS error
+			sample, errS = parseTempSample(r.Context(), data)
+			if errS != nil {
+				ErrorHandler(badReqRet, errS, http.StatusBadRequest, log, w)
+				store.Push(data, errS.Error())
+				metrics.IncTempParseFailure()
+				return
+			}
+		default:
+			c, ok := codec.Lookup(contentType)
+			if !ok {
+				ErrorHandler("Error: request header missing "+ContentTypeKey,
+					errors.New(InvalidContentType), http.StatusBadRequest, log, w)
+				return
+			}
 
-		if strings.Contains(data, ":'Temperature':") {
-			containsTemp = true
-			tempString = ":'Temperature':"
-		}
+			var payload codec.TempSamplePayload
+			if err := c.Decode(r.Body, &payload); err != nil {
+				ErrorHandler(badReqRet, err, http.StatusBadRequest, log, w)
+				store.Push(fmt.Sprintf("%+v", payload), err.Error())
+				metrics.IncTempParseFailure()
+				return
+			}
 
-		if strings.Contains(data, `":\'Temperature:\'"`) {
-			containsTemp = true
-			tempString = ":'Temperature':"
-		}
-		if !containsTemp {
-			ErrorHandler(badReqRet,
-				errors.New("No temperature keyword"),
-				http.StatusBadRequest, log, w)
-			myErrorStrings.Push(data)
-			return
+			formatted, errF := EpochStrToFormatted(r.Context(), strconv.FormatInt(payload.EpochMs, 10))
+			if errF != nil {
+				ErrorHandler(badReqRet, errF, http.StatusBadRequest, log, w)
+				store.Push(payload.DeviceID, errF.Error())
+				metrics.IncTempParseFailure()
+				return
+			}
+			sample = &TempSample{
+				DeviceID:      payload.DeviceID,
+				FormattedTime: formatted,
+				Temperature:   payload.Temperature,
+			}
 		}
 
-		fields := strings.Split(data, tempString)
-		if len(fields) != 2 {
-			ErrorHandler(badReqRet,
-				errors.New("Wrong format temp fields"),
-				http.StatusBadRequest, log, w)
-			myErrorStrings.Push(data)
-			return
+		overTemp := sample.Temperature > TempThreshold
+		if overTemp {
+			metrics.MarkOverTemp(sample.DeviceID)
+		} else {
+			metrics.MarkNormal(sample.DeviceID)
 		}
 
-		deviceFields := strings.Split(fields[0], ":")
-		if len(deviceFields) != 2 {
-			ErrorHandler(badReqRet,
-				errors.New("Wrong format: device fields"),
-				http.StatusBadRequest, log, w)
-			myErrorStrings.Push(data)
+		respData, respContentType, err := encodeTempResponse(r, sample, overTemp)
+		if err != nil {
+			ErrorHandler("HTTP 500: Error while marshalling response",
+				err, http.StatusInternalServerError, log, w)
 			return
 		}
 
-		deviceID := deviceFields[0]
-		formatT, errF := EpochStrToFormatted(deviceFields[1])
-		if errF != nil {
-			ErrorHandler(badReqRet,
-				errors.New("Wrong format: epoch time"),
-				http.StatusBadRequest, log, w)
-			myErrorStrings.Push(data)
-			return
-		}
-		temp, error1 := strconv.ParseFloat(fields[1], 64)
-		if error1 != nil {
-			ErrorHandler(badReqRet,
-				errors.New("Wrong format: parse float"),
-				http.StatusBadRequest, log, w)
-			myErrorStrings.Push(data)
+		w.Header().Set(ContentTypeKey, respContentType)
+		respCode, respErr := w.Write(respData)
+		if respErr != nil {
+			log.Errorf("Error writing response (%d): url: %s, error: %s",
+				respCode, r.URL.String(), respErr)
 			return
 		}
+		log.Infof("Request succeeded: %d: %s", respCode, respData)
+	}
+}
 
-		var respData []byte
-		if temp > TempThreshold {
-			// return `{"overtemp": true, "device_id": __device_id__, "formatted_time": __formatted_time__}`,
-			resp := OverTempResponse{
-				DeviceID:      deviceID,
-				FormattedTime: formatT,
-				OverTemp:      true,
+// encodeTempResponse renders sample's over-temp result. If the request's
+// Accept header names a registered codec other than JSON, the response
+// is encoded with that codec; otherwise the response is the original
+// plain-JSON shape, unchanged.
+func encodeTempResponse(r *http.Request, sample *TempSample, overTemp bool) ([]byte, string, error) {
+	accept := r.Header.Get(AcceptKey)
+	if accept != "" && accept != ContentTypeJSON && accept != "*/*" {
+		if c, ok := codec.Lookup(accept); ok {
+			resp := codec.TempResponsePayload{
+				DeviceID:      sample.DeviceID,
+				FormattedTime: sample.FormattedTime,
+				OverTemp:      overTemp,
 			}
-			respData, err = json.Marshal(resp)
-			if err != nil {
-				ErrorHandler(fmt.Sprintf("HTTP 500: Error while marshalling response"),
-					err, http.StatusInternalServerError, log, w)
-				return
-			}
-		} else {
-			// return `{"overtemp": false}`
-			resp := NormalTempResponse{
-				OverTemp: false,
-			}
-			respData, err = json.Marshal(resp)
-			if err != nil {
-				ErrorHandler(fmt.Sprintf("HTTP 500: Error while marshalling response"),
-					err, http.StatusInternalServerError, log, w)
-				return
+			var buf bytes.Buffer
+			if err := c.Encode(&buf, &resp); err != nil {
+				return nil, "", err
 			}
+			return buf.Bytes(), accept, nil
 		}
-		w.Header().Set(ContentTypeKey, ContentTypeJSON)
-		respCode, respErr := w.Write(respData)
-		if respErr != nil {
-			log.Printf("Error writing response (%d): url: %s, error: %s",
-				respCode, r.URL.String(), respErr)
-			return
-		}
-		log.Printf("Request succeeded: %d: %s", respCode, respData)
 	}
+
+	if overTemp {
+		// return `{"overtemp": true, "device_id": __device_id__, "formatted_time": __formatted_time__}`,
+		respData, err := json.Marshal(OverTempResponse{
+			DeviceID:      sample.DeviceID,
+			FormattedTime: sample.FormattedTime,
+			OverTemp:      true,
+		})
+		return respData, ContentTypeJSON, err
+	}
+	// return `{"overtemp": false}`
+	respData, err := json.Marshal(NormalTempResponse{OverTemp: false})
+	return respData, ContentTypeJSON, err
+}
+
+// errorsResponse is the body returned by GetErrorsHandler.
+type errorsResponse struct {
+	Errors []ErrorRecord `json:"errors"`
+	Total  int           `json:"total"`
+}
+
+// parseQueryOptions reads `limit`, `offset` and `since` (RFC3339) off the
+// request's query string into a QueryOptions. Unparseable or absent
+// values fall back to "no filter".
+func parseQueryOptions(r *http.Request) QueryOptions {
+	q := r.URL.Query()
+	var opts QueryOptions
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil {
+		opts.Limit = limit
+	}
+	if offset, err := strconv.Atoi(q.Get("offset")); err == nil {
+		opts.Offset = offset
+	}
+	if since, err := time.Parse(time.RFC3339, q.Get("since")); err == nil {
+		opts.Since = since
+	}
+	return opts
 }
 
-func GetErrorsHandler(log *log.Logger) httprouter.Handle {
+// GetErrorsHandler returns rejected device payloads from store, filtered
+// and paged by the `limit`, `offset` and `since` query parameters.
+func GetErrorsHandler(log Logger, store ErrorStore) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		errStrs := myErrorStrings.Get()
-		errStr, _ := json.Marshal(errStrs)
-		restMap := map[string]string{
-			"error": string(errStr),
-		}
-		respData, marErr := json.Marshal(restMap)
-		if marErr != nil {
-			errMsg := fmt.Sprintf(
-				"Error performing Marshal indent for errorString %v: %v",
-				errStrs, marErr,
-			)
-			log.Printf("Err %s", errMsg)
+		log.Infof("Received Get Errors request: %+v", r)
+
+		records := store.Query(parseQueryOptions(r))
+		resp := errorsResponse{
+			Errors: records,
+			Total:  store.Len(),
 		}
-		log.Printf("Received Get Errors request: %+v", r)
 
-		if respData == nil {
+		respData, marErr := json.Marshal(resp)
+		if marErr != nil {
 			ErrorHandler("Json marshal failed",
 				marErr, http.StatusInternalServerError, log, w)
 			return
@@ -376,59 +449,52 @@ func GetErrorsHandler(log *log.Logger) httprouter.Handle {
 		w.Header().Set(ContentTypeKey, ContentTypeJSON)
 		respCode, respErr := w.Write(respData)
 		if respErr != nil {
-			log.Printf(
+			log.Errorf(
 				"Error writing response (%d): url: %s, error: %s",
 				respCode, r.URL.String(), respErr)
 			return
 		}
-		log.Printf("Request succeeded: %d: %s", respCode, respData)
+		log.Infof("Request succeeded: %d: %s", respCode, respData)
 	}
 }
 
-// GetReadmeHandler returns the README.md file in HTML format
-func GetReadmeHandler(log *log.Logger) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		log.Printf("Received Get Readme request: %+v", r)
-		lines, err := ioutil.ReadFile("README.md")
-		if err != nil {
-			ErrorHandler("Error reading README.md",
-				err, http.StatusInternalServerError, log, w)
-			return
-		}
-		// md := strings.Join(lines, "\n")
 
-		opts := html.RendererOptions{
-			Flags:          html.CommonFlags,
-			RenderNodeHook: renderSections,
+// parseClearOptions reads `fromID`/`toID` or `since`/`until` (RFC3339) off
+// the request's query string into a ClearOptions. With none set, the
+// returned ClearOptions clears every record, matching the old behavior.
+func parseClearOptions(r *http.Request) ClearOptions {
+	q := r.URL.Query()
+	var opts ClearOptions
+	if toID, err := strconv.ParseUint(q.Get("toID"), 10, 64); err == nil {
+		opts.ToID = toID
+		if fromID, err := strconv.ParseUint(q.Get("fromID"), 10, 64); err == nil {
+			opts.FromID = fromID
 		}
-		renderer := html.NewRenderer(opts)
-		w.Header().Set(ContentTypeKey, ContentTypeHTML)
-		html := markdown.ToHTML(lines, nil, renderer)
-		respCode, respErr := w.Write(html)
-		if respErr != nil {
-			log.Printf(
-				"Error writing response (%d): url: %s, error: %s",
-				respCode, r.URL.String(), respErr)
-			return
+	}
+	if until, err := time.Parse(time.RFC3339, q.Get("until")); err == nil {
+		opts.Until = until
+		if since, err := time.Parse(time.RFC3339, q.Get("since")); err == nil {
+			opts.Since = since
 		}
-		log.Printf("Request succeeded: %d: %s", respCode, html)
 	}
+	return opts
 }
 
-// ErrorHandler is a helper function to handle errors
-func DeleteHandler(log *log.Logger) httprouter.Handle {
+// DeleteHandler deletes errors from store. With no query parameters it
+// deletes everything; `fromID`/`toID` or `since`/`until` (RFC3339) scope
+// the deletion to an ID range or a time window.
+func DeleteHandler(log Logger, store ErrorStore) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		log.Printf("Received Get Errors request: %+v", r)
-		len := myErrorStrings.Len()
-		myErrorStrings.Clear()
+		log.Infof("Received Delete Errors request: %+v", r)
+		deleted := store.Clear(parseClearOptions(r))
 
-		respData, marErr := json.Marshal("Success: Deleted " + strconv.Itoa(len) + " errors")
+		respData, marErr := json.Marshal("Success: Deleted " + strconv.Itoa(deleted) + " errors")
 		if marErr != nil {
 			errMsg := fmt.Sprintf(
 				"Error Marshal indent for errorString len %d: %v",
-				len, marErr,
+				deleted, marErr,
 			)
-			log.Printf("Err %s", errMsg)
+			log.Errorf("Err %s", errMsg)
 		}
 		if respData == nil {
 			ErrorHandler("No response can be returned",
@@ -436,7 +502,14 @@ func DeleteHandler(log *log.Logger) httprouter.Handle {
 			return
 		}
 
-		// w.Header().Set(ContentTypeKey, ContentTypeJSON)
-		log.Printf("Delete Request Succeeded")
+		w.Header().Set(ContentTypeKey, ContentTypeJSON)
+		respCode, respErr := w.Write(respData)
+		if respErr != nil {
+			log.Errorf(
+				"Error writing response (%d): url: %s, error: %s",
+				respCode, r.URL.String(), respErr)
+			return
+		}
+		log.Infof("Delete Request Succeeded: %d: %s", respCode, respData)
 	}
 }
@@ -30,7 +30,7 @@ const (
 	errorURL = "/testTemp"
 )
 
-var logger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+var logger = NewStructuredLogger(log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile), LevelDebug, false)
 
 func getRequest(method, data string) *http.Request {
 	b := map[string]string{
@@ -68,6 +68,9 @@ func TestTempurature(t *testing.T) {
 		overTemp    bool
 	}
 
+	store := NewMemoryErrorStore(0)
+	metrics := NewMetrics()
+
 	for _, td := range []testData{
 		{name: "Good Req Good Temp", data: "365951380:1640995229697:'Temperature':10.48256793121914", goodRequest: true, overTemp: false},
 		{name: "Good Req Bad Temp", data: "365951380:1640995229697:'Temperature':1000.48256793121914", goodRequest: true, overTemp: true},
@@ -76,7 +79,7 @@ func TestTempurature(t *testing.T) {
 		{name: "Bad Req 3", data: "365951380:1640995229697:'Tempeure':sd.48256793121914", goodRequest: false, overTemp: false},
 	} {
 		r := getRequest(http.MethodPost, td.data)
-		PostTempHandler := PostTempHandler(logger)
+		PostTempHandler := PostTempHandler(logger, store, metrics)
 		resp := GetTestResponseWithHandler(r, http.MethodPost, errorURL, PostTempHandler)
 		defer resp.Body.Close()
 		if td.goodRequest {
@@ -96,29 +99,25 @@ func TestTempurature(t *testing.T) {
 
 	// Get errors
 	r := getRequest(http.MethodGet, "")
-	PostTempHandler := GetErrorsHandler(logger)
-	resp := GetTestResponseWithHandler(r, http.MethodGet, errorURL, PostTempHandler)
+	GetErrorsHandler := GetErrorsHandler(logger, store)
+	resp := GetTestResponseWithHandler(r, http.MethodGet, errorURL, GetErrorsHandler)
 	require.Equal(t, http.StatusOK, resp.StatusCode, "get errrors")
 	respB, _ := io.ReadAll(resp.Body)
-	var params map[string]string
-	_ = json.Unmarshal(respB, &params)
-	dataStr, ok := params["error"]
-	require.True(t, ok, "should contain 'error'")
-	if len(dataStr) == 0 {
-		errArr := strings.Split(dataStr, ",")
-		require.Equal(t, 3, len(errArr), "should have 3 data")
-	}
+	var errResp errorsResponse
+	_ = json.Unmarshal(respB, &errResp)
+	require.Equal(t, 3, errResp.Total, "should have 3 errors")
+	require.Equal(t, 3, len(errResp.Errors), "should have 3 errors")
+
 	// Delete errors
 	d := getRequest(http.MethodDelete, "")
-	dHandler := DeleteHandler(logger)
+	dHandler := DeleteHandler(logger, store)
 	rDel := GetTestResponseWithHandler(d, http.MethodDelete, errorURL, dHandler)
 	require.Equal(t, http.StatusOK, rDel.StatusCode, "delete errrors")
 
 	// Get errors again, should have 0 after deletion
-	resp = GetTestResponseWithHandler(r, http.MethodGet, errorURL, PostTempHandler)
+	resp = GetTestResponseWithHandler(r, http.MethodGet, errorURL, GetErrorsHandler)
 	require.Equal(t, http.StatusOK, resp.StatusCode, "get errrors")
 	respB, _ = io.ReadAll(resp.Body)
-	_ = json.Unmarshal(respB, &params)
-	dataStr, ok = params["error"]
-	require.Equal(t, "[]", dataStr, "should have 0 errors")
+	_ = json.Unmarshal(respB, &errResp)
+	require.Equal(t, 0, errResp.Total, "should have 0 errors")
 }
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+)
+
+// streamSendBufferSize bounds how many queued over-temp notifications a
+// single device session will hold; once it is full, further notifications
+// for that session are dropped (see notifyOverTemp).
+const streamSendBufferSize = 32
+
+// streamFrame is the shape of a single frame sent by a device over the
+// stream; it mirrors the `data` field used by PostTempHandler so both
+// paths share parseTempSample.
+type streamFrame struct {
+	Data string `json:"data"`
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// deviceSession is one connected device's streaming session.
+type deviceSession struct {
+	deviceID string
+	conn     *websocket.Conn
+	send     chan []byte
+}
+
+// streamHub tracks the pool of connected device sessions.
+type streamHub struct {
+	mu       sync.Mutex
+	sessions map[string]*deviceSession
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		sessions: make(map[string]*deviceSession),
+	}
+}
+
+// register replaces any existing session for deviceID with a new one. The
+// replaced session's send channel is closed here so its runStreamWriter
+// goroutine (blocked reading from it) exits instead of leaking on every
+// reconnect.
+func (h *streamHub) register(deviceID string, conn *websocket.Conn) *deviceSession {
+	session := &deviceSession{
+		deviceID: deviceID,
+		conn:     conn,
+		send:     make(chan []byte, streamSendBufferSize),
+	}
+	h.mu.Lock()
+	if old, ok := h.sessions[deviceID]; ok {
+		close(old.send)
+	}
+	h.sessions[deviceID] = session
+	h.mu.Unlock()
+	return session
+}
+
+// unregister removes session from the hub, but only if it is still the
+// session currently registered for its device ID. This is a
+// compare-and-delete: if the device reconnected and a newer session has
+// already replaced this one in the map, unregistering the stale session
+// must not close or delete the new one out from under it.
+func (h *streamHub) unregister(session *deviceSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if current, ok := h.sessions[session.deviceID]; ok && current == session {
+		close(session.send)
+		delete(h.sessions, session.deviceID)
+	}
+}
+
+// notifyOverTemp pushes an over-temp notification to the sample's own
+// device session. The send is non-blocking: if the session's outbound
+// buffer is full the notification is dropped and logged, rather than
+// blocking the reader loop for a slow client.
+func (h *streamHub) notifyOverTemp(log Logger, sample *TempSample) {
+	h.mu.Lock()
+	session, ok := h.sessions[sample.DeviceID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	resp := OverTempResponse{
+		DeviceID:      sample.DeviceID,
+		FormattedTime: sample.FormattedTime,
+		OverTemp:      true,
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf("Err: failed to marshal over-temp notification for device %s: %v",
+			sample.DeviceID, err)
+		return
+	}
+
+	select {
+	case session.send <- payload:
+	default:
+		log.Errorf("Dropping over-temp notification for device %s: send buffer full",
+			sample.DeviceID)
+	}
+}
+
+// deviceSessions is the process-wide pool of connected device streams.
+var deviceSessions = newStreamHub()
+
+// StreamTempHandler is the handler for a persistent WebSocket connection
+// carrying device telemetry. A device opens one connection and sends a
+// `{"data": __data_string__}` frame per sample, using the same payload
+// format accepted by PostTempHandler; each frame is parsed through
+// parseTempSample so the threshold/validation logic stays identical
+// across both paths. Over-temp notifications are pushed back on the same
+// socket as they occur.
+//
+// The device ID isn't known until the first frame arrives, so the
+// session is registered with the hub lazily on first successful parse.
+func StreamTempHandler(log Logger, store ErrorStore, metrics *Metrics) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		log.Infof("Received StreamTemp upgrade request: %+v", r)
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			ErrorHandler("Error: failed to upgrade connection",
+				err, http.StatusBadRequest, log, w)
+			return
+		}
+		defer conn.Close()
+
+		var session *deviceSession
+		defer func() {
+			if session != nil {
+				deviceSessions.unregister(session)
+			}
+		}()
+
+		for {
+			_, raw, err := conn.ReadMessage()
+			if err != nil {
+				log.Infof("StreamTemp connection closed: %v", err)
+				break
+			}
+
+			var frame streamFrame
+			if err := json.Unmarshal(raw, &frame); err != nil || len(frame.Data) == 0 {
+				store.Push(string(raw), "Wrong format: stream frame")
+				metrics.IncTempParseFailure()
+				continue
+			}
+
+			sample, errS := parseTempSample(context.Background(), frame.Data)
+			if errS != nil {
+				store.Push(frame.Data, errS.Error())
+				metrics.IncTempParseFailure()
+				continue
+			}
+
+			if session == nil {
+				// Registered synchronously, here in the read loop, and
+				// only handed to the writer goroutine once fully built;
+				// the writer never observes a partially-initialized or
+				// later-mutated session.
+				session = deviceSessions.register(sample.DeviceID, conn)
+				go runStreamWriter(log, conn, session)
+			}
+
+			if sample.Temperature > TempThreshold {
+				deviceSessions.notifyOverTemp(log, sample)
+				metrics.MarkOverTemp(sample.DeviceID)
+			} else {
+				metrics.MarkNormal(sample.DeviceID)
+			}
+		}
+	}
+}
+
+// runStreamWriter drains session.send and forwards each payload to conn,
+// until the session is unregistered (which closes send) or the write to
+// conn itself fails.
+func runStreamWriter(log Logger, conn *websocket.Conn, session *deviceSession) {
+	for payload := range session.send {
+		if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+			log.Errorf("Err: failed writing to device %s: %v", session.deviceID, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamHubUnregisterIsCompareAndDelete(t *testing.T) {
+	hub := newStreamHub()
+	first := hub.register("device-1", nil)
+	second := hub.register("device-1", nil)
+
+	// Replacing a session must close the one it displaced so its
+	// runStreamWriter goroutine (blocked reading send) exits instead of
+	// leaking on every reconnect.
+	_, stillOpen := <-first.send
+	require.False(t, stillOpen, "replaced session's send channel should be closed")
+
+	// A stale session's unregister (e.g. a reconnect's old connection
+	// finally tearing down) must not remove the session that has since
+	// replaced it in the hub, nor double-close the channel register
+	// already closed.
+	hub.unregister(first)
+
+	hub.mu.Lock()
+	current, ok := hub.sessions["device-1"]
+	hub.mu.Unlock()
+	require.True(t, ok, "second session should remain registered")
+	require.Same(t, second, current)
+
+	hub.unregister(second)
+	hub.mu.Lock()
+	_, ok = hub.sessions["device-1"]
+	hub.mu.Unlock()
+	require.False(t, ok, "current session should be removed once unregistered")
+}
+
+func TestStreamTempHandlerPushesOverTempNotification(t *testing.T) {
+	store := NewMemoryErrorStore(0)
+	metrics := NewMetrics()
+	router := httprouter.New()
+	router.GET("/stream", StreamTempHandler(logger, store, metrics))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/stream"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	frame := map[string]string{"data": "365951380:1640995229697:'Temperature':1000.48256793121914"}
+	require.NoError(t, conn.WriteJSON(frame))
+
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Contains(t, string(msg), `"overtemp":true`)
+}